@@ -0,0 +1,116 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	agentRequestType = "auth-agent-req@openssh.com"
+	agentChannelType = "auth-agent@openssh.com"
+)
+
+// AgentRequestHandler decides whether a given Session is permitted to
+// forward its SSH agent to the server. It is consulted when a client
+// sends the auth-agent-req@openssh.com channel request.
+type AgentRequestHandler func(ctx Context, s Session) bool
+
+// SetAgentRequestHandler installs a handler that gates agent forwarding
+// requests. If no handler is set, forwarding is allowed for any session.
+func (srv *Server) SetAgentRequestHandler(handler AgentRequestHandler) {
+	srv.AgentRequestHandler = handler
+}
+
+// AgentForward is the listener set up by NewAgentForwarder for one
+// session's agent forwarding. Close removes the socket and its containing
+// temporary directory; it is safe to call even if ForwardAgentConnections
+// was never started, so the directory can't outlive the listener.
+type AgentForward struct {
+	Listener   net.Listener
+	SocketPath string
+}
+
+// Close closes the listener and removes its socket's temporary directory.
+func (f *AgentForward) Close() error {
+	err := f.Listener.Close()
+	os.RemoveAll(filepath.Dir(f.SocketPath))
+	return err
+}
+
+// NewAgentForwarder creates a Unix domain socket in a fresh per-session
+// temporary directory. Callers should set SSH_AUTH_SOCK to the returned
+// AgentForward.SocketPath in the session environment, and must call
+// Close (directly, or via ForwardAgentConnections) once the session ends
+// so the directory doesn't leak.
+func NewAgentForwarder(s Session) (*AgentForward, error) {
+	dir, err := os.MkdirTemp("", "ssh-agent-")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	sockPath := filepath.Join(dir, "agent."+strconv.Itoa(os.Getpid()))
+	ln, err := net.Listen("unix", sockPath)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	if err := os.Chmod(sockPath, 0600); err != nil {
+		ln.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	return &AgentForward{Listener: ln, SocketPath: sockPath}, nil
+}
+
+// ForwardAgentConnections takes connections from fwd's listener and proxies
+// them through the SSH tunnel to the client's agent, mirroring
+// ForwardX11Connections. fwd is closed once the listener stops accepting
+// connections.
+func ForwardAgentConnections(fwd *AgentForward, s Session) {
+	defer fwd.Close()
+	l := fwd.Listener
+	sshConn := s.Context().Value(ContextKeyConn).(gossh.Conn)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			channel, reqs, err := sshConn.OpenChannel(agentChannelType, nil)
+			if err != nil {
+				return
+			}
+			defer channel.Close()
+			go gossh.DiscardRequests(reqs)
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				io.Copy(conn, channel)
+				if unixConn, ok := conn.(*net.UnixConn); ok {
+					unixConn.CloseWrite()
+				}
+				wg.Done()
+			}()
+			go func() {
+				io.Copy(channel, conn)
+				channel.CloseWrite()
+				wg.Done()
+			}()
+			wg.Wait()
+		}(conn)
+	}
+}
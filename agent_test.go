@@ -0,0 +1,42 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewAgentForwarderSocketPermissions(t *testing.T) {
+	fwd, err := NewAgentForwarder(nil)
+	if err != nil {
+		t.Fatalf("NewAgentForwarder: %v", err)
+	}
+	defer fwd.Close()
+
+	info, err := os.Stat(fwd.SocketPath)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket mode = %o, want 0600", perm)
+	}
+}
+
+func TestAgentForwardCloseWithoutForwarding(t *testing.T) {
+	fwd, err := NewAgentForwarder(nil)
+	if err != nil {
+		t.Fatalf("NewAgentForwarder: %v", err)
+	}
+	dir := filepath.Dir(fwd.SocketPath)
+
+	// Close directly, without ever starting ForwardAgentConnections: the
+	// directory must still be cleaned up so it can't leak.
+	if err := fwd.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("socket dir %s leaked when forwarding never started", dir)
+	}
+}
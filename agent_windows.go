@@ -0,0 +1,39 @@
+//go:build windows
+
+package ssh
+
+import "errors"
+
+const agentRequestType = "auth-agent-req@openssh.com"
+
+// AgentRequestHandler decides whether a given Session is permitted to
+// forward its SSH agent to the server. It is consulted when a client
+// sends the auth-agent-req@openssh.com channel request.
+type AgentRequestHandler func(ctx Context, s Session) bool
+
+// SetAgentRequestHandler installs a handler that gates agent forwarding
+// requests. If no handler is set, forwarding is allowed for any session.
+func (srv *Server) SetAgentRequestHandler(handler AgentRequestHandler) {
+	srv.AgentRequestHandler = handler
+}
+
+// AgentForward is the windows stand-in for the Unix-socket-backed type of
+// the same name in agent.go; agent forwarding isn't implemented on this
+// platform, so NewAgentForwarder always fails before one is ever created.
+type AgentForward struct {
+	SocketPath string
+}
+
+// Close is a no-op; no AgentForward is ever actually constructed on windows.
+func (f *AgentForward) Close() error { return nil }
+
+// NewAgentForwarder always fails on windows: agent forwarding here would
+// need a platform-specific transport in place of the Unix domain socket
+// agent.go uses, which hasn't been implemented.
+func NewAgentForwarder(s Session) (*AgentForward, error) {
+	return nil, errors.New("ssh: agent forwarding is not supported on windows")
+}
+
+// ForwardAgentConnections is unreachable on windows, since NewAgentForwarder
+// always errors first; it exists only so session.go's dispatch compiles.
+func ForwardAgentConnections(fwd *AgentForward, s Session) {}
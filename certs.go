@@ -0,0 +1,87 @@
+package ssh
+
+import (
+	"golang.org/x/crypto/ssh"
+)
+
+// ContextKeyCertificate is the context key under which the SSH certificate
+// presented during public-key authentication is stored, once it has been
+// validated against the server's trusted CAs. Handlers can retrieve it with
+// ctx.Value(ContextKeyCertificate).(*ssh.Certificate).
+const ContextKeyCertificate = ctxKey("ssh-certificate")
+
+// CertificateHandler is consulted after a user certificate has passed the
+// standard ssh.CertChecker validation (signature, validity window and
+// principals). It receives the parsed certificate so callers can enforce
+// additional policy on critical options or extensions, e.g. rejecting a
+// force-command or source-address restriction the server can't honor.
+type CertificateHandler func(ctx Context, cert *ssh.Certificate) bool
+
+// certSupportedCriticalOptions lists the critical options CheckCert will
+// accept on a certificate rather than rejecting it outright with
+// "unsupported critical option". source-address isn't listed because
+// ssh.CertChecker special-cases it: x/crypto/ssh enforces it itself during
+// the handshake once authenticateCertificate's caller returns the
+// certificate's Permissions from the PublicKeyCallback. force-command is enforced in
+// session.go, which overrides the client-requested command for exec and
+// shell sessions when it's set.
+var certSupportedCriticalOptions = []string{"force-command"}
+
+// certChecker builds an ssh.CertChecker that trusts the server's configured
+// CA keys and accepts the critical options in certSupportedCriticalOptions.
+// It does not call CertificateHandler; authenticateCertificate does that.
+func (srv *Server) certChecker() *ssh.CertChecker {
+	checker := &ssh.CertChecker{
+		SupportedCriticalOptions: certSupportedCriticalOptions,
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			for _, ca := range srv.TrustedUserCAKeys {
+				if KeysEqual(ca, auth) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+	return checker
+}
+
+// authenticateCertificate validates key as a user certificate signed by one
+// of the server's trusted CAs for the given login user, then defers to the
+// server's CertificateHandler, if configured, to approve any critical
+// options or extensions. The validated certificate is stashed on ctx so
+// downstream handlers can consult it.
+func (srv *Server) authenticateCertificate(ctx Context, user string, key ssh.PublicKey) bool {
+	cert, ok := key.(*ssh.Certificate)
+	if !ok || cert.CertType != ssh.UserCert {
+		return false
+	}
+	if len(srv.TrustedUserCAKeys) == 0 {
+		return false
+	}
+
+	checker := srv.certChecker()
+	if !checker.IsUserAuthority(cert.SignatureKey) {
+		return false
+	}
+	if err := checker.CheckCert(user, cert); err != nil {
+		return false
+	}
+
+	ctx.SetValue(ContextKeyCertificate, cert)
+
+	if srv.CertificateHandler != nil {
+		return srv.CertificateHandler(ctx, cert)
+	}
+	return true
+}
+
+// hostSigner wraps signer in srv.HostCertificate, if one is configured, so
+// that the resulting ssh.Signer presents a certificate rather than a bare
+// public key during key exchange. Signer is returned unmodified when no
+// host certificate is set.
+func (srv *Server) hostSigner(signer ssh.Signer) (ssh.Signer, error) {
+	if srv.HostCertificate == nil {
+		return signer, nil
+	}
+	return ssh.NewCertSigner(srv.HostCertificate, signer)
+}
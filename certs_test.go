@@ -0,0 +1,144 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func mustSigner(t *testing.T) (gossh.Signer, ed25519.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey: %v", err)
+	}
+	signer, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("NewSignerFromKey: %v", err)
+	}
+	return signer, pub
+}
+
+func signedUserCert(t *testing.T, ca gossh.Signer, userPub ed25519.PublicKey, principal string) *gossh.Certificate {
+	t.Helper()
+	return signedUserCertWithPermissions(t, ca, userPub, principal, gossh.Permissions{})
+}
+
+func signedUserCertWithPermissions(t *testing.T, ca gossh.Signer, userPub ed25519.PublicKey, principal string, perms gossh.Permissions) *gossh.Certificate {
+	t.Helper()
+	sshUserPub, err := gossh.NewPublicKey(userPub)
+	if err != nil {
+		t.Fatalf("NewPublicKey: %v", err)
+	}
+	cert := &gossh.Certificate{
+		Key:             sshUserPub,
+		CertType:        gossh.UserCert,
+		ValidPrincipals: []string{principal},
+		ValidAfter:      0,
+		ValidBefore:     gossh.CertTimeInfinity,
+		Serial:          1,
+		Permissions:     perms,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatalf("SignCert: %v", err)
+	}
+	return cert
+}
+
+func TestAuthenticateCertificateAcceptsTrustedCA(t *testing.T) {
+	caSigner, _ := mustSigner(t)
+	_, userPub := mustSigner(t)
+	cert := signedUserCert(t, caSigner, userPub, "alice")
+
+	srv := &Server{TrustedUserCAKeys: []gossh.PublicKey{caSigner.PublicKey()}}
+	ctx, cancel := newContext(srv)
+	defer cancel()
+
+	if !srv.authenticateCertificate(ctx, "alice", cert) {
+		t.Fatal("expected certificate signed by a trusted CA to authenticate")
+	}
+	if got := ctx.Value(ContextKeyCertificate); got != cert {
+		t.Errorf("ContextKeyCertificate = %v, want %v", got, cert)
+	}
+}
+
+func TestAuthenticateCertificateRejectsWrongPrincipal(t *testing.T) {
+	caSigner, _ := mustSigner(t)
+	_, userPub := mustSigner(t)
+	cert := signedUserCert(t, caSigner, userPub, "alice")
+
+	srv := &Server{TrustedUserCAKeys: []gossh.PublicKey{caSigner.PublicKey()}}
+	ctx, cancel := newContext(srv)
+	defer cancel()
+
+	if srv.authenticateCertificate(ctx, "bob", cert) {
+		t.Fatal("expected certificate not valid for bob to be rejected")
+	}
+}
+
+func TestAuthenticateCertificateRejectsUntrustedCA(t *testing.T) {
+	caSigner, _ := mustSigner(t)
+	otherCA, _ := mustSigner(t)
+	_, userPub := mustSigner(t)
+	cert := signedUserCert(t, caSigner, userPub, "alice")
+
+	srv := &Server{TrustedUserCAKeys: []gossh.PublicKey{otherCA.PublicKey()}}
+	ctx, cancel := newContext(srv)
+	defer cancel()
+
+	if srv.authenticateCertificate(ctx, "alice", cert) {
+		t.Fatal("expected certificate signed by an untrusted CA to be rejected")
+	}
+}
+
+func TestAuthenticateCertificateAcceptsForceCommandAndSourceAddress(t *testing.T) {
+	caSigner, _ := mustSigner(t)
+	_, userPub := mustSigner(t)
+	cert := signedUserCertWithPermissions(t, caSigner, userPub, "alice", gossh.Permissions{
+		CriticalOptions: map[string]string{
+			"force-command":  "/usr/bin/rsync --server",
+			"source-address": "127.0.0.1/32",
+		},
+	})
+
+	srv := &Server{TrustedUserCAKeys: []gossh.PublicKey{caSigner.PublicKey()}}
+	ctx, cancel := newContext(srv)
+	defer cancel()
+
+	if !srv.authenticateCertificate(ctx, "alice", cert) {
+		t.Fatal("expected a certificate with force-command/source-address to authenticate, not be rejected as unsupported")
+	}
+}
+
+func TestAuthenticateCertificateRejectsUnsupportedCriticalOption(t *testing.T) {
+	caSigner, _ := mustSigner(t)
+	_, userPub := mustSigner(t)
+	cert := signedUserCertWithPermissions(t, caSigner, userPub, "alice", gossh.Permissions{
+		CriticalOptions: map[string]string{"some-future-option": "x"},
+	})
+
+	srv := &Server{TrustedUserCAKeys: []gossh.PublicKey{caSigner.PublicKey()}}
+	ctx, cancel := newContext(srv)
+	defer cancel()
+
+	if srv.authenticateCertificate(ctx, "alice", cert) {
+		t.Fatal("expected a certificate with an unrecognized critical option to be rejected")
+	}
+}
+
+func TestKeysEqual(t *testing.T) {
+	signerA, _ := mustSigner(t)
+	signerB, _ := mustSigner(t)
+
+	if !KeysEqual(signerA.PublicKey(), signerA.PublicKey()) {
+		t.Error("expected a key to equal itself")
+	}
+	if KeysEqual(signerA.PublicKey(), signerB.PublicKey()) {
+		t.Error("expected distinct keys to not be equal")
+	}
+	if KeysEqual(nil, signerA.PublicKey()) {
+		t.Error("expected nil to never equal a key")
+	}
+}
@@ -0,0 +1,90 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Context is the per-connection context passed to handlers. It embeds the
+// standard context.Context (canceled when the underlying connection
+// closes) and adds accessors for connection metadata.
+type Context interface {
+	context.Context
+
+	// SetValue records an arbitrary value on the context for later
+	// retrieval via Value.
+	SetValue(key, value interface{})
+
+	// User returns the username used to establish the SSH connection.
+	User() string
+
+	// RemoteAddr returns the address of the client.
+	RemoteAddr() net.Addr
+
+	// LocalAddr returns the address the server accepted the connection on.
+	LocalAddr() net.Addr
+
+	// Permissions returns the Permissions populated for this connection
+	// during authentication.
+	Permissions() *Permissions
+}
+
+// ctxKey namespaces the context keys this package sets, so they don't
+// collide with keys handlers set themselves.
+type ctxKey string
+
+const (
+	ContextKeyUser        = ctxKey("ssh-user")
+	ContextKeyPermissions = ctxKey("ssh-permissions")
+	ContextKeyServer      = ctxKey("ssh-server")
+	ContextKeyLocalAddr   = ctxKey("ssh-local-addr")
+	ContextKeyRemoteAddr  = ctxKey("ssh-remote-addr")
+	ContextKeyConn        = ctxKey("ssh-conn")
+)
+
+// Permissions wraps golang.org/x/crypto/ssh.Permissions. After the
+// handshake it holds the Permissions returned by the auth callback that
+// accepted the connection: for a certificate login, the certificate's own
+// critical options and extensions. Values set on it during authentication
+// are replaced at that point.
+type Permissions struct {
+	*gossh.Permissions
+}
+
+type sshContext struct {
+	context.Context
+	*sync.Mutex
+}
+
+func newContext(srv *Server) (*sshContext, context.CancelFunc) {
+	inner, cancel := context.WithCancel(context.Background())
+	ctx := &sshContext{Context: inner, Mutex: &sync.Mutex{}}
+	ctx.SetValue(ContextKeyServer, srv)
+	ctx.SetValue(ContextKeyPermissions, &Permissions{&gossh.Permissions{}})
+	return ctx, cancel
+}
+
+func (ctx *sshContext) SetValue(key, value interface{}) {
+	ctx.Lock()
+	defer ctx.Unlock()
+	ctx.Context = context.WithValue(ctx.Context, key, value)
+}
+
+func (ctx *sshContext) User() string {
+	return ctx.Value(ContextKeyUser).(string)
+}
+
+func (ctx *sshContext) RemoteAddr() net.Addr {
+	return ctx.Value(ContextKeyRemoteAddr).(net.Addr)
+}
+
+func (ctx *sshContext) LocalAddr() net.Addr {
+	return ctx.Value(ContextKeyLocalAddr).(net.Addr)
+}
+
+func (ctx *sshContext) Permissions() *Permissions {
+	return ctx.Value(ContextKeyPermissions).(*Permissions)
+}
@@ -0,0 +1,172 @@
+package ssh
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyAlgo identifies a host key algorithm that GeneratedHostKeys knows how
+// to produce.
+type KeyAlgo string
+
+const (
+	KeyAlgoEd25519 KeyAlgo = "ed25519"
+	KeyAlgoECDSA   KeyAlgo = "ecdsa"
+	KeyAlgoRSA     KeyAlgo = "rsa"
+)
+
+// HostKeyProvider supplies the signers a Server presents to clients during
+// key exchange. Implementations may load keys from disk, generate and
+// persist them, or fetch them from a secrets store.
+type HostKeyProvider interface {
+	Signers() ([]ssh.Signer, error)
+}
+
+type fileHostKeys struct {
+	paths      []string
+	passphrase func(path string) ([]byte, error)
+}
+
+// FileHostKeys returns a HostKeyProvider that loads OpenSSH-format private
+// keys from paths. Encrypted keys are supported if a passphrase callback is
+// set with WithPassphrase.
+func FileHostKeys(paths ...string) HostKeyProvider {
+	return &fileHostKeys{paths: paths}
+}
+
+// WithPassphrase returns a copy of the provider that decrypts encrypted
+// private keys by calling cb with the path of the key being loaded.
+func WithPassphrase(p HostKeyProvider, cb func(path string) ([]byte, error)) HostKeyProvider {
+	f, ok := p.(*fileHostKeys)
+	if !ok {
+		return p
+	}
+	return &fileHostKeys{paths: f.paths, passphrase: cb}
+}
+
+func (f *fileHostKeys) Signers() ([]ssh.Signer, error) {
+	signers := make([]ssh.Signer, 0, len(f.paths))
+	for _, path := range f.paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err := ssh.ParsePrivateKey(raw)
+		if _, encrypted := err.(*ssh.PassphraseMissingError); encrypted {
+			if f.passphrase == nil {
+				return nil, fmt.Errorf("ssh: %s is encrypted and no passphrase callback was set", path)
+			}
+			passphrase, perr := f.passphrase(path)
+			if perr != nil {
+				return nil, perr
+			}
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(raw, passphrase)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ssh: parsing %s: %w", path, err)
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+type generatedHostKeys struct {
+	dir   string
+	algos []KeyAlgo
+}
+
+// GeneratedHostKeys returns a HostKeyProvider that loads host keys for each
+// of algos from dir, generating and persisting any that don't already
+// exist. With no algos given it defaults to Ed25519, ECDSA-P256 and
+// RSA-3072, mirroring the key types sshd generates on a fresh install.
+func GeneratedHostKeys(dir string, algos ...KeyAlgo) HostKeyProvider {
+	if len(algos) == 0 {
+		algos = []KeyAlgo{KeyAlgoEd25519, KeyAlgoECDSA, KeyAlgoRSA}
+	}
+	return &generatedHostKeys{dir: dir, algos: algos}
+}
+
+func (g *generatedHostKeys) Signers() ([]ssh.Signer, error) {
+	if err := os.MkdirAll(g.dir, 0700); err != nil {
+		return nil, err
+	}
+
+	signers := make([]ssh.Signer, 0, len(g.algos))
+	for _, algo := range g.algos {
+		path := filepath.Join(g.dir, "ssh_host_"+string(algo)+"_key")
+
+		raw, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			raw, err = generateHostKeyFile(path, algo)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err := ssh.ParsePrivateKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("ssh: parsing %s: %w", path, err)
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+// generateHostKeyFile creates a new key for algo, writes it PEM-encoded to
+// path with owner-only permissions, and returns its contents.
+func generateHostKeyFile(path string, algo KeyAlgo) ([]byte, error) {
+	block, err := marshalHostKey(algo)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := pem.EncodeToMemory(block)
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func marshalHostKey(algo KeyAlgo) (*pem.Block, error) {
+	switch algo {
+	case KeyAlgoEd25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+	case KeyAlgoECDSA:
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, nil
+	case KeyAlgoRSA:
+		priv, err := rsa.GenerateKey(rand.Reader, 3072)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}, nil
+	default:
+		return nil, fmt.Errorf("ssh: unknown host key algorithm %q", algo)
+	}
+}
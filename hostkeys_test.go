@@ -0,0 +1,67 @@
+package ssh
+
+import (
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestGeneratedHostKeysPersist(t *testing.T) {
+	dir := t.TempDir()
+	provider := GeneratedHostKeys(dir, KeyAlgoEd25519)
+
+	first, err := provider.Signers()
+	if err != nil {
+		t.Fatalf("first Signers(): %v", err)
+	}
+	if len(first) != 1 {
+		t.Fatalf("len(first) = %d, want 1", len(first))
+	}
+
+	second, err := provider.Signers()
+	if err != nil {
+		t.Fatalf("second Signers(): %v", err)
+	}
+	if !KeysEqual(first[0].PublicKey(), second[0].PublicKey()) {
+		t.Fatal("expected GeneratedHostKeys to reload the same key, not mint a new one")
+	}
+}
+
+func TestFileHostKeysLoadsGeneratedKey(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := GeneratedHostKeys(dir, KeyAlgoEd25519).Signers(); err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	path := dir + "/ssh_host_ed25519_key"
+	signers, err := FileHostKeys(path).Signers()
+	if err != nil {
+		t.Fatalf("FileHostKeys.Signers(): %v", err)
+	}
+	if len(signers) != 1 {
+		t.Fatalf("len(signers) = %d, want 1", len(signers))
+	}
+}
+
+func TestServerHostSignersPrefersProvider(t *testing.T) {
+	dir := t.TempDir()
+	provider := GeneratedHostKeys(dir, KeyAlgoEd25519)
+	want, err := provider.Signers()
+	if err != nil {
+		t.Fatalf("Signers(): %v", err)
+	}
+
+	other, err := generateSigner()
+	if err != nil {
+		t.Fatalf("generateSigner(): %v", err)
+	}
+
+	srv := &Server{HostKeyProvider: provider, HostSigners: []gossh.Signer{other}}
+	got, err := srv.hostSigners()
+	if err != nil {
+		t.Fatalf("hostSigners(): %v", err)
+	}
+	if len(got) != 1 || !KeysEqual(got[0].PublicKey(), want[0].PublicKey()) {
+		t.Fatal("expected hostSigners() to use HostKeyProvider over HostSigners")
+	}
+}
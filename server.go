@@ -0,0 +1,218 @@
+package ssh
+
+import (
+	"errors"
+	"net"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Server defines parameters for running an SSH server, analogous to
+// net/http.Server.
+type Server struct {
+	// Addr is the address ListenAndServe listens on, e.g. ":22".
+	Addr string
+
+	// Handler is invoked for each accepted session once its exec or shell
+	// request has been accepted. Subsystem requests are dispatched to
+	// SubsystemHandlers instead.
+	Handler Handler
+
+	// PublicKeyHandler, if set, is consulted for every public key a client
+	// offers. It runs as x/crypto/ssh's PublicKeyCallback, which may be
+	// called before the client's signature has been checked; the login
+	// succeeds only once that signature verifies.
+	PublicKeyHandler PublicKeyHandler
+
+	// PasswordHandler, if set, is consulted for every password
+	// authentication attempt.
+	PasswordHandler PasswordHandler
+
+	// HostSigners are the signers presented to clients during key
+	// exchange, used when HostKeyProvider is nil. If both are empty, an
+	// ephemeral key is generated via generateSigner.
+	HostSigners []gossh.Signer
+
+	// HostKeyProvider, if set, supplies the signers presented during key
+	// exchange, taking precedence over HostSigners. Use FileHostKeys or
+	// GeneratedHostKeys for a host identity that survives restarts.
+	HostKeyProvider HostKeyProvider
+
+	// AgentRequestHandler, if set, gates whether a session may forward
+	// its SSH agent. See SetAgentRequestHandler.
+	AgentRequestHandler AgentRequestHandler
+
+	// HostCertificate, if set, is presented to clients as a signed host
+	// certificate for the first host signer (from HostKeyProvider or
+	// HostSigners) instead of its bare public key. If the certificate's key
+	// doesn't match that signer, connections are closed before the
+	// handshake.
+	HostCertificate *gossh.Certificate
+
+	// TrustedUserCAKeys authenticates users whose public-key auth attempt
+	// is a certificate signed by one of these CAs, in place of pinning
+	// individual authorized keys.
+	TrustedUserCAKeys []gossh.PublicKey
+
+	// CertificateHandler, if set, is consulted after a user certificate
+	// has passed standard validation against TrustedUserCAKeys, so
+	// callers can enforce policy on its critical options or extensions.
+	CertificateHandler CertificateHandler
+
+	// SubsystemHandlers maps a subsystem name, as requested by the
+	// client in a "subsystem" channel request, to the handler invoked
+	// for it. See SetSubsystemHandler.
+	SubsystemHandlers map[string]SubsystemHandler
+
+	// X11Options configures forwarding behavior for sessions that send
+	// an x11-req. X11 forwarding is only offered on platforms where
+	// x11.go builds (see its //go:build !windows constraint).
+	X11Options X11Options
+}
+
+// SetSubsystemHandler installs a handler for the named subsystem, such as
+// "sftp". It is consulted when a client sends a "subsystem" channel
+// request naming it.
+func (srv *Server) SetSubsystemHandler(name string, handler SubsystemHandler) {
+	if srv.SubsystemHandlers == nil {
+		srv.SubsystemHandlers = make(map[string]SubsystemHandler)
+	}
+	srv.SubsystemHandlers[name] = handler
+}
+
+// ListenAndServe listens on srv.Addr and serves incoming connections until
+// the listener returns an error.
+func (srv *Server) ListenAndServe() error {
+	if srv.Addr == "" {
+		return errors.New("ssh: Server.Addr must be set")
+	}
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(ln)
+}
+
+// Serve accepts and handles connections from l until it returns an error.
+func (srv *Server) Serve(l net.Listener) error {
+	signers, err := srv.hostSigners()
+	if err != nil {
+		return err
+	}
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go srv.handleConn(conn, signers)
+	}
+}
+
+// hostSigners returns the signers to present during key exchange:
+// HostKeyProvider if set, else HostSigners, else an ephemeral generated
+// key as a last resort.
+func (srv *Server) hostSigners() ([]gossh.Signer, error) {
+	if srv.HostKeyProvider != nil {
+		return srv.HostKeyProvider.Signers()
+	}
+	if len(srv.HostSigners) > 0 {
+		return srv.HostSigners, nil
+	}
+	signer, err := generateSigner()
+	if err != nil {
+		return nil, err
+	}
+	return []gossh.Signer{signer}, nil
+}
+
+// handleConn performs the SSH handshake on conn and services its session
+// channels until the connection closes.
+func (srv *Server) handleConn(conn net.Conn, signers []gossh.Signer) {
+	ctx, cancel := newContext(srv)
+	defer cancel()
+
+	config := srv.config(ctx)
+	for i, signer := range signers {
+		if i == 0 {
+			wrapped, err := srv.hostSigner(signer)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			signer = wrapped
+		}
+		config.AddHostKey(signer)
+	}
+
+	sshConn, chans, reqs, err := gossh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	defer sshConn.Close()
+
+	if sshConn.Permissions != nil {
+		ctx.SetValue(ContextKeyPermissions, &Permissions{sshConn.Permissions})
+	}
+	ctx.SetValue(ContextKeyConn, gossh.Conn(sshConn))
+	ctx.SetValue(ContextKeyLocalAddr, sshConn.LocalAddr())
+	ctx.SetValue(ContextKeyRemoteAddr, sshConn.RemoteAddr())
+
+	go gossh.DiscardRequests(reqs)
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(gossh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		sess := &session{
+			Channel: channel,
+			ctx:     ctx,
+			handler: srv.Handler,
+		}
+		go sess.handleRequests(requests)
+	}
+}
+
+// config builds the ssh.ServerConfig used for one connection's handshake.
+// Auth callbacks close over ctx so handlers see connection metadata set
+// during authentication.
+func (srv *Server) config(ctx Context) *gossh.ServerConfig {
+	config := &gossh.ServerConfig{}
+
+	if srv.PublicKeyHandler != nil || len(srv.TrustedUserCAKeys) > 0 {
+		config.PublicKeyCallback = func(meta gossh.ConnMetadata, key gossh.PublicKey) (*gossh.Permissions, error) {
+			ctx.SetValue(ContextKeyUser, meta.User())
+
+			if srv.authenticateCertificate(ctx, meta.User(), key) {
+				cert := key.(*gossh.Certificate)
+				// Returning the certificate's own Permissions, rather than
+				// an empty one, is what makes x/crypto/ssh's built-in
+				// source-address enforcement take effect, and what lets
+				// session.go see force-command afterwards.
+				return &cert.Permissions, nil
+			}
+			if srv.PublicKeyHandler != nil && srv.PublicKeyHandler(ctx, key) {
+				return &gossh.Permissions{}, nil
+			}
+			return nil, errors.New("ssh: public key rejected")
+		}
+	}
+
+	if srv.PasswordHandler != nil {
+		config.PasswordCallback = func(meta gossh.ConnMetadata, password []byte) (*gossh.Permissions, error) {
+			ctx.SetValue(ContextKeyUser, meta.User())
+			if !srv.PasswordHandler(ctx, string(password)) {
+				return nil, errors.New("ssh: password rejected")
+			}
+			return &gossh.Permissions{}, nil
+		}
+	}
+
+	return config
+}
@@ -0,0 +1,322 @@
+package ssh
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Session represents an SSH session channel together with the requests
+// negotiated over it (pty, env, exec, shell, subsystem, X11 and agent
+// forwarding).
+type Session interface {
+	gossh.Channel
+
+	// Context returns the connection's Context, canceled when the
+	// underlying connection closes.
+	Context() Context
+
+	// User returns the username used to establish the SSH connection.
+	User() string
+
+	// RemoteAddr returns the remote address for this connection.
+	RemoteAddr() net.Addr
+
+	// LocalAddr returns the local address for this connection.
+	LocalAddr() net.Addr
+
+	// Environ returns a copy of the environment set by the client for
+	// this session, as "key=value" strings.
+	Environ() []string
+
+	// Exit sends an exit status to the client and closes the session.
+	Exit(code int) error
+
+	// Command returns RawCommand split on whitespace, or nil if it is
+	// empty. Shell quoting is not interpreted.
+	Command() []string
+
+	// RawCommand returns the exact command the client provided in an
+	// exec request, or the certificate's force-command when one is set,
+	// which replaces the client's command for exec and shell sessions.
+	RawCommand() string
+
+	// Subsystem returns the name of the subsystem requested by the
+	// client, or "" if this isn't a subsystem session.
+	Subsystem() string
+
+	// Pty returns PTY information, a channel of window size changes, and
+	// whether the session was started with a PTY.
+	Pty() (Pty, <-chan Window, bool)
+
+	// Permissions returns the Permissions populated for this connection
+	// during authentication.
+	Permissions() *Permissions
+}
+
+type session struct {
+	sync.Mutex
+	gossh.Channel
+
+	ctx     Context
+	handler Handler
+
+	env       []string
+	rawCmd    string
+	subsystem string
+	pty       Pty
+	winch     chan Window
+
+	agentForward *AgentForward
+	x11Forward   *X11Forward
+
+	exited bool
+}
+
+func (sess *session) Context() Context          { return sess.ctx }
+func (sess *session) User() string              { return sess.ctx.User() }
+func (sess *session) RemoteAddr() net.Addr      { return sess.ctx.RemoteAddr() }
+func (sess *session) LocalAddr() net.Addr       { return sess.ctx.LocalAddr() }
+func (sess *session) Permissions() *Permissions { return sess.ctx.Permissions() }
+func (sess *session) RawCommand() string        { return sess.rawCmd }
+func (sess *session) Subsystem() string         { return sess.subsystem }
+
+func (sess *session) Environ() []string {
+	return append([]string{}, sess.env...)
+}
+
+func (sess *session) Command() []string {
+	if sess.rawCmd == "" {
+		return nil
+	}
+	return strings.Fields(sess.rawCmd)
+}
+
+func (sess *session) Pty() (Pty, <-chan Window, bool) {
+	if sess.winch == nil {
+		return Pty{}, nil, false
+	}
+	return sess.pty, sess.winch, true
+}
+
+// Exit sends an exit-status reply, tears down any agent/X11 forwarding
+// set up for the session, and closes the underlying channel. It is safe
+// to call more than once.
+func (sess *session) Exit(code int) error {
+	sess.Lock()
+	defer sess.Unlock()
+	if sess.exited {
+		return nil
+	}
+	sess.exited = true
+
+	if sess.x11Forward != nil {
+		sess.x11Forward.Close()
+	}
+	if sess.agentForward != nil {
+		sess.agentForward.Close()
+	}
+
+	status := struct{ Status uint32 }{uint32(code)}
+	if _, err := sess.SendRequest("exit-status", false, gossh.Marshal(&status)); err != nil {
+		sess.Close()
+		return err
+	}
+	return sess.Close()
+}
+
+// run invokes the server's Handler in a goroutine and exits the session
+// with status 0 once it returns.
+func (sess *session) run() {
+	if sess.handler == nil {
+		sess.Exit(1)
+		return
+	}
+	go func() {
+		sess.handler(sess)
+		sess.Exit(0)
+	}()
+}
+
+// handleRequests services session channel requests (pty-req, env, exec,
+// shell, window-change, and the agent/X11/subsystem requests wired in by
+// their respective features) until the channel's request stream closes.
+func (sess *session) handleRequests(reqs <-chan *gossh.Request) {
+	for req := range reqs {
+		switch req.Type {
+		case "env":
+			var kv struct{ Name, Value string }
+			if err := gossh.Unmarshal(req.Payload, &kv); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			sess.env = append(sess.env, kv.Name+"="+kv.Value)
+			req.Reply(true, nil)
+
+		case "exec":
+			var payload struct{ Command string }
+			if err := gossh.Unmarshal(req.Payload, &payload); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			sess.rawCmd = payload.Command
+			if cmd, ok := forcedCommand(sess.ctx.Permissions()); ok {
+				sess.rawCmd = cmd
+			}
+			req.Reply(true, nil)
+			sess.run()
+
+		case "shell":
+			if cmd, ok := forcedCommand(sess.ctx.Permissions()); ok {
+				sess.rawCmd = cmd
+			}
+			req.Reply(true, nil)
+			sess.run()
+
+		case "pty-req":
+			cert, _ := sess.ctx.Value(ContextKeyCertificate).(*gossh.Certificate)
+			if !certAllowsPty(cert) {
+				req.Reply(false, nil)
+				continue
+			}
+			pty, ok := parsePtyRequest(req.Payload)
+			if !ok {
+				req.Reply(false, nil)
+				continue
+			}
+			sess.pty = pty
+			sess.winch = make(chan Window, 1)
+			sess.winch <- pty.Window
+			req.Reply(true, nil)
+
+		case "window-change":
+			win, ok := parseWinchRequest(req.Payload)
+			if !ok || sess.winch == nil {
+				req.Reply(false, nil)
+				continue
+			}
+			sess.pty.Window = win
+			sess.winch <- win
+			req.Reply(true, nil)
+
+		case agentRequestType:
+			sess.handleAgentRequest(req)
+
+		case "subsystem":
+			sess.handleSubsystemRequest(req)
+
+		case x11RequestType:
+			sess.handleX11Request(req)
+
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// forcedCommand returns the force-command critical option carried by a
+// certificate-authenticated session's Permissions, if one was set. Per
+// the certificate critical-option convention, this overrides whatever
+// command the client actually requested.
+func forcedCommand(perms *Permissions) (string, bool) {
+	if perms == nil || perms.CriticalOptions == nil {
+		return "", false
+	}
+	cmd, ok := perms.CriticalOptions["force-command"]
+	return cmd, ok
+}
+
+// certAllowsPty reports whether a pty-req should be honored: always for a
+// session that didn't authenticate with a certificate, and otherwise only
+// if the certificate carries the permit-pty extension.
+func certAllowsPty(cert *gossh.Certificate) bool {
+	if cert == nil {
+		return true
+	}
+	_, ok := cert.Extensions["permit-pty"]
+	return ok
+}
+
+// handleSubsystemRequest dispatches a "subsystem" request to the matching
+// entry in the server's SubsystemHandlers, if any, mirroring how exec and
+// shell sessions run srv.Handler.
+func (sess *session) handleSubsystemRequest(req *gossh.Request) {
+	name, _, ok := parseString(req.Payload)
+	if !ok {
+		req.Reply(false, nil)
+		return
+	}
+	sess.subsystem = name
+
+	srv, _ := sess.ctx.Value(ContextKeyServer).(*Server)
+	if srv == nil {
+		req.Reply(false, nil)
+		return
+	}
+	handler, ok := srv.SubsystemHandlers[name]
+	if !ok {
+		req.Reply(false, nil)
+		return
+	}
+
+	req.Reply(true, nil)
+	go func() {
+		handler(sess)
+		sess.Exit(0)
+	}()
+}
+
+// handleAgentRequest services an auth-agent-req@openssh.com request: it
+// consults the server's AgentRequestHandler (if any), then sets up a
+// forwarding socket and exports SSH_AUTH_SOCK for the session.
+func (sess *session) handleAgentRequest(req *gossh.Request) {
+	srv, _ := sess.ctx.Value(ContextKeyServer).(*Server)
+	if srv != nil && srv.AgentRequestHandler != nil && !srv.AgentRequestHandler(sess.ctx, sess) {
+		req.Reply(false, nil)
+		return
+	}
+
+	fwd, err := NewAgentForwarder(sess)
+	if err != nil {
+		req.Reply(false, nil)
+		return
+	}
+
+	sess.agentForward = fwd
+	sess.env = append(sess.env, "SSH_AUTH_SOCK="+fwd.SocketPath)
+	req.Reply(true, nil)
+	go ForwardAgentConnections(fwd, sess)
+}
+
+// handleX11Request services an x11-req request: it parses the client's
+// X11 forwarding parameters, sets up a forwarded display via
+// NewX11Forwarder, and exports DISPLAY/XAUTHORITY for the session.
+func (sess *session) handleX11Request(req *gossh.Request) {
+	x11, ok := parseX11Request(req.Payload)
+	if !ok {
+		req.Reply(false, nil)
+		return
+	}
+
+	srv, _ := sess.ctx.Value(ContextKeyServer).(*Server)
+	var opts X11Options
+	if srv != nil {
+		opts = srv.X11Options
+	}
+
+	fwd, err := NewX11Forwarder(x11, opts)
+	if err != nil {
+		req.Reply(false, nil)
+		return
+	}
+
+	sess.x11Forward = fwd
+	sess.env = append(sess.env,
+		"DISPLAY="+fwd.Display,
+		"XAUTHORITY="+fwd.XAuthFile.Name(),
+	)
+	req.Reply(true, nil)
+	go ForwardX11Connections(fwd, sess)
+}
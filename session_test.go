@@ -0,0 +1,46 @@
+package ssh
+
+import (
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestForcedCommand(t *testing.T) {
+	if _, ok := forcedCommand(nil); ok {
+		t.Error("expected nil Permissions to carry no forced command")
+	}
+
+	empty := &Permissions{&gossh.Permissions{}}
+	if _, ok := forcedCommand(empty); ok {
+		t.Error("expected Permissions with no CriticalOptions to carry no forced command")
+	}
+
+	forced := &Permissions{&gossh.Permissions{
+		CriticalOptions: map[string]string{"force-command": "/usr/bin/rsync --server"},
+	}}
+	cmd, ok := forcedCommand(forced)
+	if !ok || cmd != "/usr/bin/rsync --server" {
+		t.Errorf("forcedCommand(forced) = %q, %v, want %q, true", cmd, ok, "/usr/bin/rsync --server")
+	}
+}
+
+func TestCertAllowsPty(t *testing.T) {
+	if !certAllowsPty(nil) {
+		t.Error("expected a non-certificate session to always allow pty allocation")
+	}
+
+	withoutExtension := &gossh.Certificate{}
+	if certAllowsPty(withoutExtension) {
+		t.Error("expected a certificate without permit-pty to reject pty allocation")
+	}
+
+	withExtension := &gossh.Certificate{
+		Permissions: gossh.Permissions{
+			Extensions: map[string]string{"permit-pty": ""},
+		},
+	}
+	if !certAllowsPty(withExtension) {
+		t.Error("expected a certificate with permit-pty to allow pty allocation")
+	}
+}
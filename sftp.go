@@ -0,0 +1,216 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// SubsystemHandler handles an SSH "subsystem" channel request, such as
+// sftp. It receives the Session the same way a regular command Handler
+// does; s.Subsystem() reports which subsystem was requested.
+type SubsystemHandler func(s Session)
+
+// SFTPOptions configures the built-in sftp subsystem handler returned by
+// SFTPHandler.
+type SFTPOptions struct {
+	// Root is the directory the sftp server is confined to. Every
+	// request path is resolved against it before touching disk, so a
+	// client cannot read or write outside it via an absolute path or a
+	// "../" traversal. Ignored if FS is set.
+	Root string
+
+	// ReadOnly rejects any operation that would write to the
+	// filesystem. Always in effect when FS is set, since fs.FS has no
+	// write operations.
+	ReadOnly bool
+
+	// FS, if set, overrides Root and serves sftp requests read-only out
+	// of an arbitrary fs.FS, e.g. to chroot a user into a virtual
+	// filesystem built per-session.
+	FS func(s Session) fs.FS
+}
+
+// SFTPHandler returns a SubsystemHandler that serves the sftp protocol
+// over the session channel using github.com/pkg/sftp's request-based
+// server, honoring opts' root directory, read-only mode and per-session
+// filesystem override. Register it with srv.SetSubsystemHandler("sftp", ...).
+func SFTPHandler(opts SFTPOptions) SubsystemHandler {
+	return func(s Session) {
+		var handlers sftp.Handlers
+		if opts.FS != nil {
+			handlers = fsHandler{fsys: opts.FS(s)}.handlers()
+		} else {
+			handlers = rootHandler{root: opts.Root, readOnly: opts.ReadOnly}.handlers()
+		}
+
+		server := sftp.NewRequestServer(s, handlers)
+		defer server.Close()
+
+		if err := server.Serve(); err != nil && err != io.EOF {
+			s.Exit(1)
+			return
+		}
+		s.Exit(0)
+	}
+}
+
+// rootHandler implements sftp.Handlers directly against the host
+// filesystem, confined to root: every request path is resolved with
+// resolve before being passed to an os function, so "../" segments and
+// absolute-looking client paths can't escape it. Symlink and Link
+// requests are rejected outright, since a symlink planted inside root
+// could otherwise point back out of it.
+type rootHandler struct {
+	root     string
+	readOnly bool
+}
+
+func (h rootHandler) handlers() sftp.Handlers {
+	return sftp.Handlers{FileGet: h, FilePut: h, FileCmd: h, FileList: h}
+}
+
+// resolve maps an sftp request path onto a path inside root. Cleaning it
+// as an absolute path first, the same way net/http.Dir does, means a
+// request for "/../../etc/passwd" or "../../etc/passwd" both collapse to
+// root+"/etc/passwd" rather than escaping root.
+func (h rootHandler) resolve(reqPath string) string {
+	return filepath.Join(h.root, filepath.Clean("/"+reqPath))
+}
+
+func (h rootHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	return os.Open(h.resolve(r.Filepath))
+}
+
+func (h rootHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	if h.readOnly {
+		return nil, os.ErrPermission
+	}
+	flags := os.O_WRONLY | os.O_CREATE
+	if r.Pflags().Append {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+	}
+	return os.OpenFile(h.resolve(r.Filepath), flags, 0644)
+}
+
+func (h rootHandler) Filecmd(r *sftp.Request) error {
+	if h.readOnly {
+		return os.ErrPermission
+	}
+	switch r.Method {
+	case "Setstat":
+		return nil
+	case "Rename":
+		return os.Rename(h.resolve(r.Filepath), h.resolve(r.Target))
+	case "Rmdir", "Remove":
+		return os.Remove(h.resolve(r.Filepath))
+	case "Mkdir":
+		return os.Mkdir(h.resolve(r.Filepath), 0755)
+	}
+	return errors.New("sftp: unsupported method " + r.Method)
+}
+
+func (h rootHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	return listDirOrStat(h.resolve(r.Filepath), r.Method, os.ReadDir, os.Stat)
+}
+
+// fsHandler implements sftp.Handlers read-only against an arbitrary
+// fs.FS. Like rootHandler it cleans every request path as an absolute path
+// (see fsPath), so ".." segments collapse at the root of the fs.FS and
+// can't climb above it.
+type fsHandler struct {
+	fsys fs.FS
+}
+
+func (h fsHandler) handlers() sftp.Handlers {
+	return sftp.Handlers{FileGet: h, FilePut: h, FileCmd: h, FileList: h}
+}
+
+// fsPath converts an sftp request path, which is always absolute from
+// the client's point of view, into the slash-separated relative path
+// fs.FS expects.
+func fsPath(reqPath string) string {
+	clean := strings.TrimPrefix(path.Clean("/"+reqPath), "/")
+	if clean == "" {
+		return "."
+	}
+	return clean
+}
+
+func (h fsHandler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	data, err := fs.ReadFile(h.fsys, fsPath(r.Filepath))
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (h fsHandler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return nil, os.ErrPermission
+}
+
+func (h fsHandler) Filecmd(r *sftp.Request) error {
+	return os.ErrPermission
+}
+
+func (h fsHandler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	name := fsPath(r.Filepath)
+	return listDirOrStat(name, r.Method,
+		func(string) ([]os.DirEntry, error) { return fs.ReadDir(h.fsys, name) },
+		func(string) (os.FileInfo, error) { return fs.Stat(h.fsys, name) },
+	)
+}
+
+// listDirOrStat implements the List/Stat half of a FileLister shared by
+// rootHandler and fsHandler, which differ only in how they read a
+// directory or stat a path.
+func listDirOrStat(target, method string, readDir func(string) ([]os.DirEntry, error), stat func(string) (os.FileInfo, error)) (sftp.ListerAt, error) {
+	switch method {
+	case "List":
+		entries, err := readDir(target)
+		if err != nil {
+			return nil, err
+		}
+		infos := make([]os.FileInfo, 0, len(entries))
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+		}
+		return listerAt(infos), nil
+
+	case "Stat":
+		info, err := stat(target)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{info}, nil
+	}
+	return nil, errors.New("sftp: unsupported method " + method)
+}
+
+// listerAt adapts a slice of os.FileInfo to sftp.ListerAt, the same way
+// the pkg/sftp examples do.
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(dst []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(dst, l[offset:])
+	if n < len(dst) {
+		return n, io.EOF
+	}
+	return n, nil
+}
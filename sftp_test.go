@@ -0,0 +1,87 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/sftp"
+)
+
+func TestRootHandlerConfinesTraversal(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "in-root.txt"), []byte("safe"), 0644); err != nil {
+		t.Fatalf("seeding root: %v", err)
+	}
+
+	secret := t.TempDir()
+	if err := os.WriteFile(filepath.Join(secret, "secret.txt"), []byte("top secret"), 0644); err != nil {
+		t.Fatalf("seeding secret dir: %v", err)
+	}
+
+	h := rootHandler{root: root}.handlers()
+
+	for _, traversal := range []string{
+		filepath.Join("..", filepath.Base(secret), "secret.txt"),
+		"/" + filepath.Join("..", filepath.Base(secret), "secret.txt"),
+	} {
+		if _, err := h.FileGet.Fileread(sftp.NewRequest("Get", traversal)); err == nil {
+			t.Errorf("Fileread(%q) escaped root and reached %s", traversal, secret)
+		}
+	}
+
+	// A legitimate path inside root must still work.
+	reader, err := h.FileGet.Fileread(sftp.NewRequest("Get", "/in-root.txt"))
+	if err != nil {
+		t.Fatalf("Fileread(in-root.txt): %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := reader.ReadAt(buf, 0); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if string(buf) != "safe" {
+		t.Errorf("read %q, want %q", buf, "safe")
+	}
+}
+
+func TestRootHandlerReadOnlyRejectsWrites(t *testing.T) {
+	root := t.TempDir()
+	h := rootHandler{root: root, readOnly: true}.handlers()
+
+	if _, err := h.FilePut.Filewrite(sftp.NewRequest("Put", "/new.txt")); err == nil {
+		t.Error("expected Filewrite to fail in read-only mode")
+	}
+	if err := h.FileCmd.Filecmd(sftp.NewRequest("Mkdir", "/newdir")); err == nil {
+		t.Error("expected Filecmd to fail in read-only mode")
+	}
+}
+
+func TestFSHandlerServesReadOnly(t *testing.T) {
+	fsys := fstest.MapFS{
+		"greeting.txt": &fstest.MapFile{Data: []byte("hello")},
+	}
+	h := fsHandler{fsys: fsys}.handlers()
+
+	reader, err := h.FileGet.Fileread(sftp.NewRequest("Get", "/greeting.txt"))
+	if err != nil {
+		t.Fatalf("Fileread: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := reader.ReadAt(buf, 0); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("read %q, want %q", buf, "hello")
+	}
+
+	if _, err := h.FilePut.Filewrite(sftp.NewRequest("Put", "/greeting.txt")); err == nil {
+		t.Error("expected Filewrite against an fs.FS to be rejected")
+	}
+
+	// fsPath collapses ".." at the root, so this traversal attempt becomes
+	// "outside.txt", which fsys doesn't contain, and fails as not found.
+	if _, err := h.FileGet.Fileread(sftp.NewRequest("Get", "/../outside.txt")); err == nil {
+		t.Error("expected a traversal attempt against fsHandler to fail")
+	}
+}
@@ -0,0 +1,64 @@
+package ssh
+
+import (
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Window represents the dimensions of a terminal.
+type Window struct {
+	Width  int
+	Height int
+}
+
+// Pty represents a PTY request and the terminal it describes.
+type Pty struct {
+	Term   string
+	Window Window
+}
+
+// X11 represents an "x11-req" channel request: the client's X11
+// forwarding parameters.
+type X11 struct {
+	SingleConnection bool
+	AuthProtocol     string
+	AuthData         string
+	ScreenNumber     int
+}
+
+// X11Options configures the X11 forwarding behavior of a Server. It is
+// declared here, rather than in x11.go, so that Server.X11Options builds
+// on every platform even though forwarding itself (see NewX11Forwarder)
+// is only available where x11.go's !windows constraint is satisfied.
+type X11Options struct {
+	// Untrusted causes the server to mint its own MIT-MAGIC-COOKIE-1 for
+	// each forwarded display instead of trusting the cookie supplied by
+	// the client. ForwardX11Connections then verifies every connection
+	// presents that cookie before rewriting it back to the client's real
+	// one and splicing the connection into the SSH channel. This isolates
+	// the fake display from whatever the client's X server would
+	// otherwise trust.
+	Untrusted bool
+
+	// MaxDisplays caps how many display numbers NewX11Forwarder will try
+	// while looking for a free one. Zero uses a default of 4096.
+	MaxDisplays int
+}
+
+// Handler is invoked once a session's exec or shell request has been
+// accepted; subsystem requests go to a SubsystemHandler instead. It is
+// responsible for running the session to completion; the session is exited
+// with status 0 when it returns.
+type Handler func(s Session)
+
+// PublicKeyHandler is invoked for each public key a client offers for
+// authentication. It may be called before the client's signature over the
+// key has been checked.
+type PublicKeyHandler func(ctx Context, key PublicKey) bool
+
+// PasswordHandler is invoked for each password authentication attempt.
+type PasswordHandler func(ctx Context, password string) bool
+
+// PublicKey is an SSH public key, matching golang.org/x/crypto/ssh.PublicKey.
+type PublicKey interface {
+	gossh.PublicKey
+}
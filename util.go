@@ -1,21 +1,37 @@
 package ssh
 
 import (
+	"crypto/ed25519"
 	"crypto/rand"
-	"crypto/rsa"
+	"crypto/subtle"
 	"encoding/binary"
 
 	"golang.org/x/crypto/ssh"
 )
 
+// generateSigner produces an ephemeral host key for servers that set
+// neither HostSigners nor a HostKeyProvider. It exists purely as a
+// last-resort fallback; callers that care about a stable host identity
+// across restarts should use GeneratedHostKeys or FileHostKeys instead.
 func generateSigner() (ssh.Signer, error) {
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	_, key, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
 		return nil, err
 	}
 	return ssh.NewSignerFromKey(key)
 }
 
+// KeysEqual reports whether ak and bk are the same public key, by
+// comparing their marshaled wire representations in constant time.
+func KeysEqual(ak, bk PublicKey) bool {
+	if ak == nil || bk == nil {
+		return false
+	}
+	a := ak.Marshal()
+	b := bk.Marshal()
+	return len(a) == len(b) && subtle.ConstantTimeCompare(a, b) == 1
+}
+
 func parsePtyRequest(s []byte) (pty Pty, ok bool) {
 	term, s, ok := parseString(s)
 	if !ok {
@@ -3,12 +3,16 @@
 package ssh
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"syscall"
@@ -21,9 +25,21 @@ const (
 	x11RequestType = "x11-req"
 	x11ChannelType = "x11"
 
-	X11DisplayHost     = "localhost"
-	X11DisplayBasePort = 6000
-	X11DisplayOffset   = 10
+	X11DisplayOffset = 10
+
+	// x11UnixSocketDir is where X servers and clients conventionally look
+	// for Unix-domain display sockets.
+	x11UnixSocketDir = "/tmp/.X11-unix"
+
+	// x11DefaultMaxDisplays bounds how many display numbers
+	// NewX11Forwarder will try before giving up, absent an explicit
+	// X11Options.MaxDisplays.
+	x11DefaultMaxDisplays = 4096
+
+	// x11ConnInitHeaderLen is the fixed-size portion of an X11 client
+	// connection setup request, preceding the variable-length
+	// authorization-protocol-name and authorization-protocol-data.
+	x11ConnInitHeaderLen = 12
 )
 
 type x11ChannelData struct {
@@ -43,6 +59,36 @@ type XAuthority struct {
 	Data      string
 }
 
+// X11Forward is a display set up by NewX11Forwarder: the listener X
+// clients connect through, the Xauthority file backing it, and the
+// DISPLAY value to export into the session environment. Close tears both
+// down.
+type X11Forward struct {
+	Listener  net.Listener
+	XAuthFile *os.File
+	Display   string
+
+	auth *x11Auth
+}
+
+// Close removes the Xauthority file and closes the listener, which for a
+// Unix-socket display also unlinks its socket file.
+func (f *X11Forward) Close() error {
+	os.Remove(f.XAuthFile.Name())
+	return f.Listener.Close()
+}
+
+// x11Auth carries the authentication data negotiated for one forwarded
+// display: the protocol and cookie the client will actually use to talk to
+// its real X server, and, for untrusted forwarding, the server-generated
+// cookie that callers are expected to present instead.
+type x11Auth struct {
+	protocol     string
+	clientCookie []byte
+	serverCookie []byte // nil unless X11Options.Untrusted
+	single       bool
+}
+
 // isLittleEndian returns whether the host architecture uses little-endian.
 func isLittleEndian() bool {
 	var i int32 = 0x01020304
@@ -52,15 +98,19 @@ func isLittleEndian() bool {
 	return b == 0x04
 }
 
-// prepareXAuthority returns the content of an .Xauthority file that can be
-// used to connect to the proxied X11 display, using the fake authentication
-// data created by the SSH client.
-func prepareXAuthority(request X11, seat int) ([]byte, error) {
-	data, err := hex.DecodeString(request.AuthData)
-	if err != nil {
+// generateX11Cookie returns a fresh 128-bit MIT-MAGIC-COOKIE-1 cookie.
+func generateX11Cookie() ([]byte, error) {
+	cookie := make([]byte, 16)
+	if _, err := rand.Read(cookie); err != nil {
 		return nil, err
 	}
+	return cookie, nil
+}
 
+// prepareXAuthority returns the content of an .Xauthority file that can be
+// used to connect to the proxied X11 display, authenticating with protocol
+// and cookie.
+func prepareXAuthority(protocol string, cookie []byte, seat int) ([]byte, error) {
 	hostname, err := os.Hostname()
 	if err != nil {
 		return nil, err
@@ -71,8 +121,8 @@ func prepareXAuthority(request X11, seat int) ([]byte, error) {
 
 	addrLen := uint16(len(hostname))
 	numberLen := uint16(len(number))
-	nameLen := uint16(len(request.AuthProtocol))
-	dataLen := uint16(len(data))
+	nameLen := uint16(len(protocol))
+	dataLen := uint16(len(cookie))
 
 	buf := make([]byte, addrLen+numberLen+nameLen+dataLen+10)
 	pos := uint16(0)
@@ -96,74 +146,188 @@ func prepareXAuthority(request X11, seat int) ([]byte, error) {
 
 	binary.BigEndian.PutUint16(buf[pos:], nameLen)
 	pos += 2
-	copy(buf[pos:], []byte(request.AuthProtocol))
+	copy(buf[pos:], []byte(protocol))
 	pos += nameLen
 
 	binary.BigEndian.PutUint16(buf[pos:], dataLen)
 	pos += 2
-	copy(buf[pos:], data)
+	copy(buf[pos:], cookie)
 	return buf, nil
 }
 
-// NewX11Forwarder sets up a temporary TCP socket that can be communicated
-// to the session environment and used for forwarding X11 traffic.
-// It also sets up an Xauthority file with appropriate authentication data.
-func NewX11Forwarder(request X11) (net.Listener, *os.File, error) {
-	var err error
+// listenX11Display atomically claims the next available X11 Unix-socket
+// display number under /tmp/.X11-unix, returning a listener bound to it and
+// the display number. Binding a Unix socket path is itself atomic, so
+// unlike a linear TCP port scan this never races concurrent sessions onto
+// the same display, and isn't bounded by a fixed pool of ports.
+func listenX11Display(maxDisplays int) (net.Listener, int, error) {
+	if err := os.MkdirAll(x11UnixSocketDir, 0o1777); err != nil {
+		return nil, 0, err
+	}
+
+	var lastErr error
+	for n := X11DisplayOffset; n < X11DisplayOffset+maxDisplays; n++ {
+		path := filepath.Join(x11UnixSocketDir, "X"+strconv.Itoa(n))
+		ln, err := net.Listen("unix", path)
+		if err == nil {
+			return ln, n, nil
+		}
+		lastErr = err
+	}
+	return nil, 0, fmt.Errorf("ssh: x11: no available display under %s: %w", x11UnixSocketDir, lastErr)
+}
+
+// NewX11Forwarder claims a Unix-socket X11 display and sets up an
+// Xauthority file with appropriate authentication data. When opts.Untrusted
+// is set, the file is authenticated with a freshly generated cookie rather
+// than the one the client supplied; the returned X11Forward records both
+// so ForwardX11Connections can verify and rewrite incoming connections.
+func NewX11Forwarder(request X11, opts X11Options) (*X11Forward, error) {
+	clientCookie, err := hex.DecodeString(request.AuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &x11Auth{
+		protocol:     request.AuthProtocol,
+		clientCookie: clientCookie,
+		single:       request.SingleConnection,
+	}
+
+	cookie := clientCookie
+	if opts.Untrusted {
+		serverCookie, err := generateX11Cookie()
+		if err != nil {
+			return nil, err
+		}
+		auth.serverCookie = serverCookie
+		cookie = serverCookie
+	}
+
+	maxDisplays := opts.MaxDisplays
+	if maxDisplays <= 0 {
+		maxDisplays = x11DefaultMaxDisplays
+	}
+
+	ln, display, err := listenX11Display(maxDisplays)
+	if err != nil {
+		return nil, err
+	}
 
 	xauthFile, err := os.CreateTemp("", ".Xauthority")
 	if err != nil {
-		return nil, nil, err
+		ln.Close()
+		return nil, err
 	}
 
-	// Try to find an available port to proxy X11 connections.
-	// X11DisplayOffset is used to limit the risk of a conflict with
-	// the host's X11 seats.
-	for i := 0; i < 50; i++ {
-		port := int(X11DisplayBasePort + X11DisplayOffset + i)
-		addr := net.JoinHostPort(X11DisplayHost, strconv.Itoa(port))
-		ln, err := net.Listen("tcp", addr)
-		if err == nil {
-			buf, err := prepareXAuthority(request, X11DisplayOffset+i)
-			if err != nil {
-				ln.Close()
-				os.Remove(xauthFile.Name())
-				return nil, nil, err
-			}
+	buf, err := prepareXAuthority(auth.protocol, cookie, display)
+	if err != nil {
+		ln.Close()
+		os.Remove(xauthFile.Name())
+		return nil, err
+	}
+	if err := os.WriteFile(xauthFile.Name(), buf, 0600); err != nil {
+		ln.Close()
+		os.Remove(xauthFile.Name())
+		return nil, err
+	}
 
-			err = os.WriteFile(xauthFile.Name(), buf, 0600)
-			if err != nil {
-				ln.Close()
-				os.Remove(xauthFile.Name())
-				return nil, nil, err
-			}
+	return &X11Forward{
+		Listener:  ln,
+		XAuthFile: xauthFile,
+		Display:   "unix:" + strconv.Itoa(display),
+		auth:      auth,
+	}, nil
+}
 
-			return ln, xauthFile, nil
-		}
-		log.Println(err)
+// pad4 rounds n up to the next multiple of 4, matching the padding the X11
+// wire protocol applies to the auth-protocol-name and auth-protocol-data
+// fields of a connection setup request.
+func pad4(n int) int {
+	if n%4 == 0 {
+		return n
+	}
+	return n + (4 - n%4)
+}
+
+// readX11ConnInit reads the X11 client connection setup request from conn,
+// verifies its MIT-MAGIC-COOKIE-1 cookie against auth.serverCookie, and
+// returns the request with the cookie rewritten to auth.clientCookie so it
+// can be forwarded to the client's real X server.
+func readX11ConnInit(conn net.Conn, auth *x11Auth) ([]byte, error) {
+	header := make([]byte, x11ConnInitHeaderLen)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, fmt.Errorf("ssh: x11: reading connection header: %w", err)
 	}
 
-	os.Remove(xauthFile.Name())
-	return nil, nil, err
+	order := binary.ByteOrder(binary.BigEndian)
+	if header[0] == 'l' {
+		order = binary.LittleEndian
+	}
+	nameLen := int(order.Uint16(header[6:8]))
+	dataLen := int(order.Uint16(header[8:10]))
+
+	body := make([]byte, pad4(nameLen)+pad4(dataLen))
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, fmt.Errorf("ssh: x11: reading auth fields: %w", err)
+	}
+
+	name := body[:nameLen]
+	data := body[pad4(nameLen) : pad4(nameLen)+dataLen]
+
+	if string(name) != auth.protocol || subtle.ConstantTimeCompare(data, auth.serverCookie) != 1 {
+		return nil, fmt.Errorf("ssh: x11: cookie mismatch from %s", conn.RemoteAddr())
+	}
+	copy(data, auth.clientCookie)
+
+	return append(header, body...), nil
 }
 
-// ForwardX11Connections takes X11 connections from a listener and proxies them
-// through the SSH tunnel to the client's DISPLAY.
-func ForwardX11Connections(l net.Listener, xauth *os.File, s Session) {
-	defer os.Remove(xauth.Name())
+// ForwardX11Connections takes X11 connections from fwd's listener and
+// proxies them through the SSH tunnel to the client's DISPLAY. If the
+// client requested a single connection, the listener is closed after the
+// first accepted connection. If fwd carries a server-generated cookie
+// (untrusted forwarding), each connection's cookie is verified and
+// rewritten before it is spliced into the SSH channel; connections that
+// present the wrong cookie are rejected and logged.
+func ForwardX11Connections(fwd *X11Forward, s Session) {
+	defer fwd.Close()
+	l, auth := fwd.Listener, fwd.auth
 	sshConn := s.Context().Value(ContextKeyConn).(gossh.Conn)
 	for {
 		conn, err := l.Accept()
 		if err != nil {
 			return
 		}
+		if auth.single {
+			l.Close()
+		}
 		go func(conn net.Conn) {
 			defer conn.Close()
-			originAddr, originPortStr, _ := net.SplitHostPort(conn.RemoteAddr().String())
-			originPort, _ := strconv.Atoi(originPortStr)
+
+			var prefix []byte
+			if auth.serverCookie != nil {
+				rewritten, err := readX11ConnInit(conn, auth)
+				if err != nil {
+					log.Println(err)
+					return
+				}
+				prefix = rewritten
+			}
+
+			// Unix-socket connections carry no meaningful host:port, so
+			// the origin fields are filled in with placeholders; clients
+			// treat them as advisory.
+			originAddr, originPort := "127.0.0.1", uint32(0)
+			if host, portStr, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+				originAddr = host
+				if p, err := strconv.Atoi(portStr); err == nil {
+					originPort = uint32(p)
+				}
+			}
 			payload := gossh.Marshal(&x11ChannelData{
 				OriginAddr: originAddr,
-				OriginPort: uint32(originPort),
+				OriginPort: originPort,
 			})
 			channel, reqs, err := sshConn.OpenChannel(x11ChannelType, payload)
 			if err != nil {
@@ -171,12 +335,19 @@ func ForwardX11Connections(l net.Listener, xauth *os.File, s Session) {
 			}
 			defer channel.Close()
 			go gossh.DiscardRequests(reqs)
+
+			if len(prefix) > 0 {
+				if _, err := channel.Write(prefix); err != nil {
+					return
+				}
+			}
+
 			var wg sync.WaitGroup
 			wg.Add(2)
 			go func() {
 				io.Copy(conn, channel)
-				if tcpConn, ok := conn.(*net.TCPConn); ok {
-					tcpConn.CloseWrite()
+				if unixConn, ok := conn.(*net.UnixConn); ok {
+					unixConn.CloseWrite()
 				}
 				wg.Done()
 			}()
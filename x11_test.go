@@ -0,0 +1,81 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestPad4(t *testing.T) {
+	cases := map[int]int{0: 0, 1: 4, 2: 4, 3: 4, 4: 4, 5: 8, 16: 16, 17: 20}
+	for n, want := range cases {
+		if got := pad4(n); got != want {
+			t.Errorf("pad4(%d) = %d, want %d", n, got, want)
+		}
+	}
+}
+
+// buildConnInit encodes a big-endian X11 client connection setup request
+// carrying protocol/data, matching what readX11ConnInit expects to parse.
+func buildConnInit(protocol string, data []byte) []byte {
+	header := make([]byte, x11ConnInitHeaderLen)
+	header[0] = 'B'
+	binary.BigEndian.PutUint16(header[6:8], uint16(len(protocol)))
+	binary.BigEndian.PutUint16(header[8:10], uint16(len(data)))
+
+	body := make([]byte, pad4(len(protocol))+pad4(len(data)))
+	copy(body, protocol)
+	copy(body[pad4(len(protocol)):], data)
+
+	return append(header, body...)
+}
+
+func TestReadX11ConnInitRewritesCookie(t *testing.T) {
+	clientCookie := []byte("0123456789abcdef")
+	serverCookie := []byte("fedcba9876543210")
+	auth := &x11Auth{
+		protocol:     "MIT-MAGIC-COOKIE-1",
+		clientCookie: clientCookie,
+		serverCookie: serverCookie,
+	}
+
+	client, server := net.Pipe()
+	pkt := buildConnInit(auth.protocol, serverCookie)
+	go func() {
+		client.Write(pkt)
+		client.Close()
+	}()
+
+	rewritten, err := readX11ConnInit(server, auth)
+	if err != nil {
+		t.Fatalf("readX11ConnInit: %v", err)
+	}
+	if !bytes.Contains(rewritten, clientCookie) {
+		t.Error("expected rewritten packet to carry the client's real cookie")
+	}
+	if bytes.Contains(rewritten, serverCookie) {
+		t.Error("expected the server-generated cookie not to reach the client's X server")
+	}
+}
+
+func TestReadX11ConnInitRejectsWrongCookie(t *testing.T) {
+	auth := &x11Auth{
+		protocol:     "MIT-MAGIC-COOKIE-1",
+		clientCookie: []byte("0123456789abcdef"),
+		serverCookie: []byte("fedcba9876543210"),
+	}
+
+	client, server := net.Pipe()
+	pkt := buildConnInit(auth.protocol, []byte("wrongwrongwrongw"))
+	go func() {
+		client.Write(pkt)
+		client.Close()
+	}()
+
+	if _, err := readX11ConnInit(server, auth); err == nil {
+		t.Fatal("expected a connection presenting the wrong cookie to be rejected")
+	}
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package ssh
+
+import (
+	"errors"
+	"os"
+)
+
+const x11RequestType = "x11-req"
+
+// X11Forward is the windows stand-in for the listener-backed type of the
+// same name in x11.go; X11 forwarding isn't implemented on this platform,
+// so NewX11Forwarder always fails before one is ever created.
+type X11Forward struct {
+	Display   string
+	XAuthFile *os.File
+}
+
+// Close is a no-op; no X11Forward is ever actually constructed on windows.
+func (f *X11Forward) Close() error { return nil }
+
+// NewX11Forwarder always fails on windows: x11.go's forwarding relies on
+// Unix-domain display sockets under /tmp/.X11-unix, which has no windows
+// equivalent implemented here.
+func NewX11Forwarder(request X11, opts X11Options) (*X11Forward, error) {
+	return nil, errors.New("ssh: x11 forwarding is not supported on windows")
+}
+
+// ForwardX11Connections is unreachable on windows, since NewX11Forwarder
+// always errors first; it exists only so session.go's dispatch compiles.
+func ForwardX11Connections(fwd *X11Forward, s Session) {}